@@ -0,0 +1,137 @@
+/*
+Copyright 2020 The Flux CD contributors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	// ReadyCondition is the name of the Kustomization condition that
+	// summarizes the overall sync status.
+	ReadyCondition = "Ready"
+
+	// ArtifactFailedReason represents the fact that the artifact acquisition
+	// for a Kustomization failed.
+	ArtifactFailedReason = "ArtifactFailed"
+
+	// BuildFailedReason represents the fact that the kustomize build for a
+	// Kustomization failed.
+	BuildFailedReason = "BuildFailed"
+
+	// ApplyFailedReason represents the fact that the apply of a
+	// Kustomization's resources failed.
+	ApplyFailedReason = "ApplyFailed"
+
+	// ApplySucceedReason represents the fact that the apply of a
+	// Kustomization's resources succeeded.
+	ApplySucceedReason = "ApplySucceed"
+
+	// VarsSubstitutionFailedReason represents the fact that the
+	// postBuild.substituteFrom variable substitution of a Kustomization
+	// failed, e.g. because a referenced ConfigMap/Secret is missing or a
+	// required variable has no value.
+	VarsSubstitutionFailedReason = "VarsSubstitutionFailed"
+
+	// ValidationFailedReason represents the fact that one or more of the
+	// resources rendered by a Kustomization's kustomize build do not
+	// conform to the basic Kubernetes API conventions.
+	ValidationFailedReason = "ValidationFailed"
+
+	// PartiallyAppliedReason represents the fact that, with
+	// spec.partialApply enabled, one or more resources of a Kustomization
+	// failed to apply while the rest were successfully committed.
+	PartiallyAppliedReason = "PartiallyApplied"
+
+	// ReconcilingReason represents the fact that a Kustomization's
+	// reconciliation was cancelled before it could finish, e.g. because the
+	// controller is shutting down, and will be retried.
+	ReconcilingReason = "Reconciling"
+)
+
+// Condition contains details for one aspect of the current state of a
+// Kustomization.
+type Condition struct {
+	// Type of the condition, currently ('Ready').
+	Type string `json:"type"`
+
+	// Status of the condition, one of ('True', 'False', 'Unknown').
+	Status corev1.ConditionStatus `json:"status"`
+
+	// LastTransitionTime is the timestamp corresponding to the last status
+	// change of this condition.
+	// +optional
+	LastTransitionTime metav1.Time `json:"lastTransitionTime,omitempty"`
+
+	// Reason is a brief machine readable explanation for the condition's
+	// last transition.
+	// +optional
+	Reason string `json:"reason,omitempty"`
+
+	// Message is a human readable description of the details of the last
+	// transition, complementing reason.
+	// +optional
+	Message string `json:"message,omitempty"`
+}
+
+// KustomizationReady sets the Ready condition of a Kustomization to 'True'
+// and returns the modified object.
+func KustomizationReady(k Kustomization, reason, message string) Kustomization {
+	k.Status.Conditions = setCondition(k.Status.Conditions, Condition{
+		Type:               ReadyCondition,
+		Status:             corev1.ConditionTrue,
+		LastTransitionTime: metav1.Now(),
+		Reason:             reason,
+		Message:            message,
+	})
+	return k
+}
+
+// KustomizationNotReady sets the Ready condition of a Kustomization to
+// 'False' and returns the modified object.
+func KustomizationNotReady(k Kustomization, reason, message string) Kustomization {
+	k.Status.Conditions = setCondition(k.Status.Conditions, Condition{
+		Type:               ReadyCondition,
+		Status:             corev1.ConditionFalse,
+		LastTransitionTime: metav1.Now(),
+		Reason:             reason,
+		Message:            message,
+	})
+	return k
+}
+
+// KustomizationReadyMessage returns the message of the Ready condition of a
+// Kustomization, or an empty string if the condition is not set.
+func KustomizationReadyMessage(k Kustomization) string {
+	for _, condition := range k.Status.Conditions {
+		if condition.Type == ReadyCondition {
+			return condition.Message
+		}
+	}
+	return ""
+}
+
+func setCondition(conditions []Condition, condition Condition) []Condition {
+	for i, c := range conditions {
+		if c.Type == condition.Type {
+			conditions[i] = condition
+			return conditions
+		}
+	}
+	return append(conditions, condition)
+}
@@ -0,0 +1,160 @@
+/*
+Copyright 2020 The Flux CD contributors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	// KustomizationKind is the string representation of a Kustomization.
+	KustomizationKind = "Kustomization"
+
+	// SyncAtAnnotation is the annotation used for triggering a
+	// reconciliation outside of the spec.interval period.
+	SyncAtAnnotation = "fluxcd.io/syncAt"
+)
+
+// KustomizationSpec defines the desired state of a Kustomization.
+type KustomizationSpec struct {
+	// Path to the directory containing the kustomization.yaml file. The
+	// directory must contain a kustomization file; none is generated for a
+	// directory of plain YAMLs.
+	// +optional
+	Path string `json:"path,omitempty"`
+
+	// Prune enables garbage collection of resources that were previously
+	// applied by this Kustomization but are no longer present in the
+	// rendered output. The value is a label selector used to identify
+	// which resources are owned by this Kustomization.
+	// +optional
+	Prune string `json:"prune,omitempty"`
+
+	// The interval at which to reconcile the Kustomization.
+	// +required
+	Interval metav1.Duration `json:"interval"`
+
+	// GitRepositoryRef refers to the GitRepository object containing the
+	// Kubernetes manifests to reconcile.
+	// +required
+	GitRepositoryRef corev1.LocalObjectReference `json:"gitRepositoryRef"`
+
+	// PostBuild describes how the YAML manifest generated by the kustomize
+	// build should be mutated before it is applied to the cluster.
+	// +optional
+	PostBuild *PostBuild `json:"postBuild,omitempty"`
+
+	// Force instructs the controller to recreate resources when a patch
+	// fails because a field is immutable, instead of failing the sync.
+	// +optional
+	Force bool `json:"force,omitempty"`
+
+	// NamePrefix is prepended to the names of all resources, so the same
+	// base can be reused across environments without forking it.
+	// +kubebuilder:validation:MinLength=1
+	// +kubebuilder:validation:MaxLength=200
+	// +optional
+	NamePrefix string `json:"namePrefix,omitempty"`
+
+	// NameSuffix is appended to the names of all resources, so the same
+	// base can be reused across environments without forking it.
+	// +kubebuilder:validation:MinLength=1
+	// +kubebuilder:validation:MaxLength=200
+	// +optional
+	NameSuffix string `json:"nameSuffix,omitempty"`
+
+	// PartialApply instructs the controller to apply every resource
+	// independently instead of aborting the sync on the first failing
+	// resource, committing the resources that succeeded and reporting the
+	// ones that didn't in the Ready condition.
+	// +optional
+	PartialApply bool `json:"partialApply,omitempty"`
+
+	// This flag tells the controller to suspend subsequent kustomize
+	// executions, it does not apply to already started executions.
+	// +optional
+	Suspend bool `json:"suspend,omitempty"`
+}
+
+// PostBuild describes which actions to perform on the YAML manifest
+// generated by running kustomize build.
+type PostBuild struct {
+	// Substitute holds a map of key/value pairs used for variable
+	// substitution, taking precedence over the variables loaded from
+	// SubstituteFrom on conflicting keys.
+	// +optional
+	Substitute map[string]string `json:"substitute,omitempty"`
+
+	// SubstituteFrom is a list of ConfigMap/Secret references whose data
+	// keys are merged into the variable map used for substitution.
+	// +optional
+	SubstituteFrom []SubstituteReference `json:"substituteFrom,omitempty"`
+}
+
+// SubstituteReference contains a reference to a resource containing the
+// variables name and value.
+type SubstituteReference struct {
+	// Kind of the values referent, valid values are ('Secret', 'ConfigMap').
+	// +kubebuilder:validation:Enum=Secret;ConfigMap
+	Kind string `json:"kind"`
+
+	// Name of the values referent, in the same namespace as the
+	// Kustomization.
+	Name string `json:"name"`
+}
+
+// KustomizationStatus defines the observed state of a Kustomization.
+type KustomizationStatus struct {
+	// +optional
+	Conditions []Condition `json:"conditions,omitempty"`
+
+	// LastAppliedRevision is the revision of the artifact that was last
+	// successfully applied.
+	// +optional
+	LastAppliedRevision string `json:"lastAppliedRevision,omitempty"`
+
+	// LastAttemptedRevision is the revision of the artifact that was last
+	// attempted to be applied, regardless of the outcome.
+	// +optional
+	LastAttemptedRevision string `json:"lastAttemptedRevision,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+// +kubebuilder:subresource:status
+
+// Kustomization is the Schema for the kustomizations API.
+type Kustomization struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   KustomizationSpec   `json:"spec,omitempty"`
+	Status KustomizationStatus `json:"status,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+
+// KustomizationList contains a list of Kustomization.
+type KustomizationList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []Kustomization `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&Kustomization{}, &KustomizationList{})
+}
@@ -0,0 +1,222 @@
+/*
+Copyright 2020 The Flux CD contributors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	k8syaml "k8s.io/apimachinery/pkg/util/yaml"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/yaml"
+)
+
+// readUnstructuredObjects splits a multi-document YAML manifest, as emitted
+// by kustomize build, into individual unstructured objects. Each document is
+// decoded leniently into a map rather than straight into
+// unstructured.Unstructured, whose own UnmarshalJSON rejects a document
+// missing apiVersion/kind outright -- that would turn a typo'd or malformed
+// resource into a BuildFailedReason here, instead of letting it reach
+// validateObjects and surface as ValidationFailedReason alongside the rest
+// of the offending documents.
+func readUnstructuredObjects(manifest []byte) ([]*unstructured.Unstructured, error) {
+	reader := k8syaml.NewYAMLReader(bufio.NewReader(bytes.NewReader(manifest)))
+
+	var objects []*unstructured.Unstructured
+	for {
+		doc, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		if len(bytes.TrimSpace(doc)) == 0 {
+			continue
+		}
+
+		var m map[string]interface{}
+		if err := yaml.Unmarshal(doc, &m); err != nil {
+			return nil, fmt.Errorf("invalid YAML document: %w", err)
+		}
+		objects = append(objects, &unstructured.Unstructured{Object: m})
+	}
+
+	return objects, nil
+}
+
+// apply server-side applies every object using fieldOwner as the field
+// manager, so conflicting ownership between the controller and other actors
+// is resolved the same way `kubectl apply --server-side` resolves it. When
+// force is set, an object whose patch fails because a field is immutable
+// (e.g. a Job's spec.selector, or a Service's spec.clusterIP) is deleted and
+// recreated instead of failing the sync.
+//
+// When partialApply is false, apply stops and returns at the first failing
+// object, matching transaction-style "all or nothing" semantics. When true,
+// every object is attempted independently -- mirroring
+// `kubectl apply --validate=false` applied document-by-document -- and the
+// per-object failures are returned alongside an aggregate error so the
+// caller can still commit the successes.
+//
+// Once every object has applied cleanly, and prune is non-empty, apply
+// garbage collects resources that match the prune label selector but are
+// no longer present in objects, the same way `kubectl apply --prune -l
+// <selector>` does. Pruning is skipped when any object failed to apply, so
+// a partially rendered or partially applied set never causes resources to
+// be deleted in error.
+func (r *KustomizationReconciler) apply(ctx context.Context, objects []*unstructured.Unstructured, prune string, force, partialApply bool) ([]string, error) {
+	var failures []string
+
+	for _, u := range objects {
+		if err := r.applyOne(ctx, u, force); err != nil {
+			failure := fmt.Sprintf("%s/%s: %s", u.GetKind(), u.GetName(), err)
+			if !partialApply {
+				return nil, fmt.Errorf("%s", failure)
+			}
+			failures = append(failures, failure)
+		}
+	}
+
+	if len(failures) > 0 {
+		return failures, fmt.Errorf("%d of %d resource(s) failed to apply", len(failures), len(objects))
+	}
+
+	if prune != "" {
+		if err := r.prune(ctx, objects, prune); err != nil {
+			return nil, fmt.Errorf("prune error: %w", err)
+		}
+	}
+	return nil, nil
+}
+
+// prune deletes every object matching the selector, among the
+// (GroupVersionKind, namespace) pairs present in objects, that is not
+// itself present in objects. Restricting pruning to the kinds already found
+// in objects mirrors `kubectl apply --prune`, which otherwise has no way to
+// know which kinds this Kustomization owns; restricting each List to the
+// namespace the matching objects were rendered into keeps it from sweeping
+// up same-labelled resources that happen to live in another namespace, the
+// same way `kubectl apply --prune -l` is namespace-scoped. Objects of those
+// kinds in the same namespace that match the selector are pruned whoever
+// created them, including those of another Kustomization sharing the
+// selector.
+func (r *KustomizationReconciler) prune(ctx context.Context, objects []*unstructured.Unstructured, selector string) error {
+	sel, err := labels.Parse(selector)
+	if err != nil {
+		return fmt.Errorf("invalid prune selector %q: %w", selector, err)
+	}
+
+	scopes := make(map[pruneScope]bool)
+	kept := make(map[string]bool)
+	for _, u := range objects {
+		gvk := u.GroupVersionKind()
+		scopes[pruneScope{gvk: gvk, namespace: u.GetNamespace()}] = true
+		kept[pruneKey(gvk, u.GetNamespace(), u.GetName())] = true
+	}
+
+	var failures []string
+	for s := range scopes {
+		var candidates unstructured.UnstructuredList
+		candidates.SetGroupVersionKind(s.gvk.GroupVersion().WithKind(s.gvk.Kind + "List"))
+
+		opts := []client.ListOption{client.MatchingLabelsSelector{Selector: sel}}
+		if s.namespace != "" {
+			opts = append(opts, client.InNamespace(s.namespace))
+		}
+
+		if err := r.Client.List(ctx, &candidates, opts...); err != nil {
+			failures = append(failures, fmt.Sprintf("unable to list %s in namespace %q for pruning: %s", s.gvk, s.namespace, err))
+			continue
+		}
+
+		for i := range candidates.Items {
+			stale := candidates.Items[i]
+			if kept[pruneKey(s.gvk, stale.GetNamespace(), stale.GetName())] {
+				continue
+			}
+			if err := r.Client.Delete(ctx, &stale); err != nil && !apierrors.IsNotFound(err) {
+				failures = append(failures, fmt.Sprintf("unable to prune %s/%s: %s", stale.GetKind(), stale.GetName(), err))
+			}
+		}
+	}
+
+	if len(failures) > 0 {
+		return fmt.Errorf("%s", strings.Join(failures, "\n"))
+	}
+	return nil
+}
+
+// pruneScope identifies a (kind, namespace) pair whose candidates for
+// pruning must be listed together.
+type pruneScope struct {
+	gvk       schema.GroupVersionKind
+	namespace string
+}
+
+func pruneKey(gvk schema.GroupVersionKind, namespace, name string) string {
+	return fmt.Sprintf("%s/%s/%s", gvk, namespace, name)
+}
+
+// applyOne applies a single object, retrying with a forced delete+recreate
+// when force is set and the patch failed because of an immutable field.
+func (r *KustomizationReconciler) applyOne(ctx context.Context, u *unstructured.Unstructured, force bool) error {
+	err := r.Client.Patch(ctx, u, client.Apply, client.ForceOwnership, client.FieldOwner(fieldOwner))
+	if err == nil {
+		return nil
+	}
+
+	if !force || !isImmutableFieldError(err) {
+		return err
+	}
+
+	return r.forceApply(ctx, u)
+}
+
+// forceApply deletes and recreates a single object whose immutable fields
+// changed, then records a ForcedReapply event so users can see why the
+// object churned instead of being patched in place.
+func (r *KustomizationReconciler) forceApply(ctx context.Context, u *unstructured.Unstructured) error {
+	if err := r.Client.Delete(ctx, u.DeepCopy()); err != nil && !apierrors.IsNotFound(err) {
+		return fmt.Errorf("unable to delete for forced recreation: %w", err)
+	}
+
+	if err := r.Client.Create(ctx, u); err != nil {
+		return fmt.Errorf("unable to recreate after forced delete: %w", err)
+	}
+
+	if r.EventRecorder != nil {
+		r.EventRecorder.Eventf(u, corev1.EventTypeNormal, "ForcedReapply",
+			"recreated %s/%s because an immutable field changed", u.GetKind(), u.GetName())
+	}
+	return nil
+}
+
+// isImmutableFieldError reports whether err is the API server rejecting a
+// patch because it would change a field that cannot be updated in place.
+func isImmutableFieldError(err error) bool {
+	return apierrors.IsInvalid(err) && strings.Contains(err.Error(), "immutable")
+}
@@ -0,0 +1,213 @@
+/*
+Copyright 2020 The Flux CD contributors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"testing"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+// fakeApplyClient wraps a fake client and emulates enough of server-side
+// apply to exercise applyOne's control flow. The controller-runtime fake
+// client of this vintage does not implement the Apply patch type, so
+// forwarding an apply patch straight to it would fail every object
+// regardless of failName; successful "applies" are instead translated into
+// a create-or-update against the fake client. The named object's first
+// patch attempt is made to fail the way the API server rejects a change to
+// an immutable field, e.g. a Job's spec.selector.
+type fakeApplyClient struct {
+	client.Client
+	failName string
+	failOnce bool
+}
+
+func (c *fakeApplyClient) Patch(ctx context.Context, obj runtime.Object, patch client.Patch, opts ...client.PatchOption) error {
+	u := obj.(*unstructured.Unstructured)
+	if !c.failOnce && u.GetName() == c.failName {
+		c.failOnce = true
+		return apierrors.NewInvalid(
+			schema.GroupKind{Kind: u.GetKind()},
+			u.GetName(),
+			field.ErrorList{field.Forbidden(field.NewPath("spec", "selector"), "field is immutable")},
+		)
+	}
+
+	existing := u.DeepCopy()
+	err := c.Client.Get(ctx, client.ObjectKey{Namespace: u.GetNamespace(), Name: u.GetName()}, existing)
+	if apierrors.IsNotFound(err) {
+		return c.Client.Create(ctx, u)
+	}
+	if err != nil {
+		return err
+	}
+	u.SetResourceVersion(existing.GetResourceVersion())
+	return c.Client.Update(ctx, u)
+}
+
+func newTestJob(name string) *unstructured.Unstructured {
+	u := &unstructured.Unstructured{}
+	u.SetAPIVersion("batch/v1")
+	u.SetKind("Job")
+	u.SetName(name)
+	u.SetNamespace("default")
+	return u
+}
+
+func TestApply_ForceRecreatesOnImmutableFieldError(t *testing.T) {
+	job := newTestJob("migrate")
+
+	c := &fakeApplyClient{Client: fake.NewFakeClient(job.DeepCopy()), failName: "migrate"}
+	r := &KustomizationReconciler{Client: c, EventRecorder: record.NewFakeRecorder(10)}
+
+	if _, err := r.apply(context.Background(), []*unstructured.Unstructured{job}, "", true, false); err != nil {
+		t.Fatalf("expected forced apply to succeed, got error: %v", err)
+	}
+
+	got := &unstructured.Unstructured{}
+	got.SetAPIVersion("batch/v1")
+	got.SetKind("Job")
+	if err := c.Get(context.Background(), client.ObjectKey{Namespace: "default", Name: "migrate"}, got); err != nil {
+		t.Fatalf("expected job to exist after forced recreation: %v", err)
+	}
+}
+
+func TestApply_WithoutForceFailsOnImmutableFieldError(t *testing.T) {
+	job := newTestJob("migrate")
+
+	c := &fakeApplyClient{Client: fake.NewFakeClient(job.DeepCopy()), failName: "migrate"}
+	r := &KustomizationReconciler{Client: c}
+
+	if _, err := r.apply(context.Background(), []*unstructured.Unstructured{job}, "", false, false); err == nil {
+		t.Fatalf("expected apply to fail without force")
+	}
+}
+
+func TestApply_PartialApplyCommitsSuccessesAndReturnsFailures(t *testing.T) {
+	good := newTestJob("good")
+	bad := newTestJob("bad")
+
+	c := &fakeApplyClient{Client: fake.NewFakeClient(good.DeepCopy(), bad.DeepCopy()), failName: "bad"}
+	r := &KustomizationReconciler{Client: c}
+
+	failures, err := r.apply(context.Background(), []*unstructured.Unstructured{good, bad}, "", false, true)
+	if err == nil {
+		t.Fatalf("expected an aggregate error reporting the failed resource")
+	}
+	if len(failures) != 1 {
+		t.Fatalf("expected exactly one failure, got %d: %v", len(failures), failures)
+	}
+}
+
+// widgetGVK is a made-up custom resource kind. Pruning has to List the
+// cluster, and the default client-go scheme has no notion of arbitrary
+// kustomize-rendered CRDs -- real cluster Lists go through a generic
+// dynamic/unstructured client regardless of kind. widgetScheme registers
+// Widget/WidgetList as Unstructured/UnstructuredList to reproduce that on
+// the fake client, which otherwise requires every listed kind to be a
+// concretely registered Go type.
+var widgetGVK = schema.GroupVersionKind{Group: "example.com", Version: "v1", Kind: "Widget"}
+
+func widgetScheme() *runtime.Scheme {
+	s := runtime.NewScheme()
+	s.AddKnownTypeWithName(widgetGVK, &unstructured.Unstructured{})
+	s.AddKnownTypeWithName(widgetGVK.GroupVersion().WithKind(widgetGVK.Kind+"List"), &unstructured.UnstructuredList{})
+	return s
+}
+
+func newTestWidget(name string) *unstructured.Unstructured {
+	return newTestWidgetIn(name, "default")
+}
+
+func newTestWidgetIn(name, namespace string) *unstructured.Unstructured {
+	u := &unstructured.Unstructured{}
+	u.SetGroupVersionKind(widgetGVK)
+	u.SetName(name)
+	u.SetNamespace(namespace)
+	return u
+}
+
+func TestApply_PruneDeletesStaleObjectsMatchingSelector(t *testing.T) {
+	kept := newTestWidget("keep")
+	kept.SetLabels(map[string]string{"app": "demo"})
+
+	stale := newTestWidget("stale")
+	stale.SetLabels(map[string]string{"app": "demo"})
+
+	unrelated := newTestWidget("unrelated")
+	unrelated.SetLabels(map[string]string{"app": "other"})
+
+	c := &fakeApplyClient{Client: fake.NewFakeClientWithScheme(widgetScheme(), kept.DeepCopy(), stale.DeepCopy(), unrelated.DeepCopy())}
+	r := &KustomizationReconciler{Client: c}
+
+	if _, err := r.apply(context.Background(), []*unstructured.Unstructured{kept}, "app=demo", false, false); err != nil {
+		t.Fatalf("expected apply to succeed, got error: %v", err)
+	}
+
+	if err := getTestWidget(c, "keep"); err != nil {
+		t.Fatalf("expected kept object to remain, got: %v", err)
+	}
+	if err := getTestWidget(c, "unrelated"); err != nil {
+		t.Fatalf("expected non-matching object to remain, got: %v", err)
+	}
+	if err := getTestWidget(c, "stale"); !apierrors.IsNotFound(err) {
+		t.Fatalf("expected stale object matching the selector to be pruned, got: %v", err)
+	}
+}
+
+func getTestWidget(c client.Client, name string) error {
+	return getTestWidgetIn(c, name, "default")
+}
+
+func getTestWidgetIn(c client.Client, name, namespace string) error {
+	got := &unstructured.Unstructured{}
+	got.SetGroupVersionKind(widgetGVK)
+	return c.Get(context.Background(), client.ObjectKey{Namespace: namespace, Name: name}, got)
+}
+
+func TestApply_PruneDoesNotCrossNamespaces(t *testing.T) {
+	kept := newTestWidgetIn("keep", "default")
+	kept.SetLabels(map[string]string{"app": "demo"})
+
+	staleSameNamespace := newTestWidgetIn("stale", "default")
+	staleSameNamespace.SetLabels(map[string]string{"app": "demo"})
+
+	otherNamespace := newTestWidgetIn("stale", "other")
+	otherNamespace.SetLabels(map[string]string{"app": "demo"})
+
+	c := &fakeApplyClient{Client: fake.NewFakeClientWithScheme(widgetScheme(), kept.DeepCopy(), staleSameNamespace.DeepCopy(), otherNamespace.DeepCopy())}
+	r := &KustomizationReconciler{Client: c}
+
+	if _, err := r.apply(context.Background(), []*unstructured.Unstructured{kept}, "app=demo", false, false); err != nil {
+		t.Fatalf("expected apply to succeed, got error: %v", err)
+	}
+
+	if err := getTestWidgetIn(c, "stale", "default"); !apierrors.IsNotFound(err) {
+		t.Fatalf("expected same-namespace stale object to be pruned, got: %v", err)
+	}
+	if err := getTestWidgetIn(c, "stale", "other"); err != nil {
+		t.Fatalf("expected matching object in an unrelated namespace to remain, got: %v", err)
+	}
+}
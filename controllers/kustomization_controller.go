@@ -17,44 +17,83 @@ limitations under the License.
 package controllers
 
 import (
+	"archive/tar"
+	"compress/gzip"
 	"context"
 	"fmt"
-	"io/ioutil"
-	"os"
-	"os/exec"
+	"io"
+	"net/http"
+	"strings"
 	"time"
 
 	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	"sigs.k8s.io/controller-runtime/pkg/source"
+	"sigs.k8s.io/kustomize/api/filesys"
+	"sigs.k8s.io/kustomize/api/krusty"
 
 	kustomizev1 "github.com/fluxcd/kustomize-controller/api/v1alpha1"
 	sourcev1 "github.com/fluxcd/source-controller/api/v1alpha1"
 )
 
+// fieldOwner is the server-side apply field manager used for all resources
+// applied by this controller.
+const fieldOwner = "kustomize-controller"
+
 // KustomizationReconciler reconciles a Kustomization object
 type KustomizationReconciler struct {
 	client.Client
-	Log    logr.Logger
-	Scheme *runtime.Scheme
+	Log           logr.Logger
+	Scheme        *runtime.Scheme
+	RESTMapper    meta.RESTMapper
+	EventRecorder record.EventRecorder
+
+	// Ctx is cancelled when the manager is shutting down, so that an
+	// in-flight reconcile can unwind instead of being killed mid-apply. If
+	// nil, Reconcile falls back to context.Background().
+	Ctx context.Context
 }
 
 // +kubebuilder:rbac:groups=kustomize.fluxcd.io,resources=kustomizations,verbs=get;list;watch;create;update;patch;delete
 // +kubebuilder:rbac:groups=kustomize.fluxcd.io,resources=kustomizations/status,verbs=get;update;patch
 
 func (r *KustomizationReconciler) Reconcile(req ctrl.Request) (ctrl.Result, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+	start := time.Now()
+
+	managerCtx := r.Ctx
+	if managerCtx == nil {
+		managerCtx = context.Background()
+	}
+	ctx, cancel := context.WithTimeout(managerCtx, 15*time.Second)
 	defer cancel()
 
 	var kustomization kustomizev1.Kustomization
 	if err := r.Get(ctx, req.NamespacedName, &kustomization); err != nil {
+		if apierrors.IsNotFound(err) {
+			recordSuspend(req.Name, req.Namespace, true, false)
+		}
 		return ctrl.Result{}, client.IgnoreNotFound(err)
 	}
 
 	log := r.Log.WithValues(kustomization.Kind, req.NamespacedName)
 
+	recordSuspend(req.Name, req.Namespace, false, kustomization.Spec.Suspend)
+	if kustomization.Spec.Suspend {
+		log.Info("Kustomization is suspended, skipping reconciliation")
+		return ctrl.Result{}, nil
+	}
+
+	defer recordReconcileDuration(req.Name, req.Namespace, start)
+
 	// get artifact source
 	var repository sourcev1.GitRepository
 	repositoryName := types.NamespacedName{
@@ -70,9 +109,15 @@ func (r *KustomizationReconciler) Reconcile(req ctrl.Request) (ctrl.Result, erro
 	// try git sync
 	syncedKustomization, err := r.sync(ctx, *kustomization.DeepCopy(), repository)
 	if err != nil {
+		if ctx.Err() != nil {
+			log.Info("Kustomization sync cancelled, recording Reconciling status and will retry on next reconcile")
+			return ctrl.Result{Requeue: true}, r.recordReconciling(kustomization)
+		}
 		log.Error(err, "Kustomization sync failed")
 	}
 
+	recordReadyCondition(syncedKustomization)
+
 	// update status
 	if err := r.Status().Update(ctx, &syncedKustomization); err != nil {
 		log.Error(err, "unable to update Kustomization status")
@@ -89,9 +134,48 @@ func (r *KustomizationReconciler) SetupWithManager(mgr ctrl.Manager) error {
 	return ctrl.NewControllerManagedBy(mgr).
 		For(&kustomizev1.Kustomization{}).
 		WithEventFilter(KustomizationSyncAtPredicate{}).
+		Watches(
+			&source.Kind{Type: &corev1.ConfigMap{}},
+			&handler.EnqueueRequestsFromMapFunc{ToRequests: handler.ToRequestsFunc(r.requestsForSubstituteFromChange("ConfigMap"))},
+		).
+		Watches(
+			&source.Kind{Type: &corev1.Secret{}},
+			&handler.EnqueueRequestsFromMapFunc{ToRequests: handler.ToRequestsFunc(r.requestsForSubstituteFromChange("Secret"))},
+		).
 		Complete(r)
 }
 
+// requestsForSubstituteFromChange returns a mapper that, given a changed
+// ConfigMap or Secret, enqueues every Kustomization in the same namespace
+// that references it via postBuild.substituteFrom.
+func (r *KustomizationReconciler) requestsForSubstituteFromChange(kind string) func(handler.MapObject) []reconcile.Request {
+	return func(obj handler.MapObject) []reconcile.Request {
+		ctx := context.Background()
+
+		var list kustomizev1.KustomizationList
+		if err := r.Client.List(ctx, &list, client.InNamespace(obj.Meta.GetNamespace())); err != nil {
+			r.Log.Error(err, "unable to list Kustomizations for substituteFrom watch", "kind", kind, "name", obj.Meta.GetName())
+			return nil
+		}
+
+		var requests []reconcile.Request
+		for _, k := range list.Items {
+			if k.Spec.PostBuild == nil {
+				continue
+			}
+			for _, ref := range k.Spec.PostBuild.SubstituteFrom {
+				if ref.Kind == kind && ref.Name == obj.Meta.GetName() {
+					requests = append(requests, reconcile.Request{
+						NamespacedName: types.NamespacedName{Namespace: k.Namespace, Name: k.Name},
+					})
+					break
+				}
+			}
+		}
+		return requests
+	}
+}
+
 func (r *KustomizationReconciler) sync(
 	ctx context.Context,
 	kustomization kustomizev1.Kustomization,
@@ -101,62 +185,101 @@ func (r *KustomizationReconciler) sync(
 		return kustomizev1.KustomizationNotReady(kustomization, kustomizev1.ArtifactFailedReason, err.Error()), err
 	}
 
-	// create tmp dir
-	tmpDir, err := ioutil.TempDir("", repository.Name)
-	if err != nil {
-		err = fmt.Errorf("tmp dir error: %w", err)
-		return kustomizev1.KustomizationNotReady(kustomization, sourcev1.StorageOperationFailedReason, err.Error()), err
-	}
-	defer os.RemoveAll(tmpDir)
-
-	// download artifact and extract files
-	url := repository.Status.Artifact.URL
-	cmd := fmt.Sprintf("cd %s && curl -sL %s | tar -xz --strip-components=1 -C .", tmpDir, url)
-	command := exec.CommandContext(ctx, "/bin/sh", "-c", cmd)
-	output, err := command.CombinedOutput()
-	if err != nil {
+	// fetch the artifact into an in-memory filesystem
+	fs := filesys.MakeFsInMemory()
+	if err := fetchArtifact(ctx, repository.Status.Artifact.URL, fs); err != nil {
 		err = fmt.Errorf("artifact acquisition failed: %w", err)
 		return kustomizev1.KustomizationNotReady(
 			kustomization,
 			kustomizev1.ArtifactFailedReason,
 			err.Error(),
-		), fmt.Errorf("artifact download `%s` error: %s", url, string(output))
+		), err
 	}
 
 	// kustomize build
 	buildDir := kustomization.Spec.Path
-	cmd = fmt.Sprintf("cd %s && kustomize build %s > %s.yaml", tmpDir, buildDir, kustomization.GetName())
-	command = exec.CommandContext(ctx, "/bin/sh", "-c", cmd)
-	output, err = command.CombinedOutput()
+	if buildDir == "" {
+		buildDir = "."
+	}
+
+	if err := injectNameOverrides(fs, buildDir, kustomization.Spec.NamePrefix, kustomization.Spec.NameSuffix); err != nil {
+		err = fmt.Errorf("unable to apply name overrides: %w", err)
+		return kustomizev1.KustomizationNotReady(
+			kustomization,
+			kustomizev1.BuildFailedReason,
+			err.Error(),
+		), err
+	}
+
+	resMap, err := krusty.MakeKustomizer(fs, krusty.MakeDefaultOptions()).Run(buildDir)
 	if err != nil {
 		err = fmt.Errorf("kustomize build error: %w", err)
-		fmt.Println(string(output))
 		return kustomizev1.KustomizationNotReady(
 			kustomization,
 			kustomizev1.BuildFailedReason,
 			err.Error(),
-		), fmt.Errorf("kustomize build error: %s", string(output))
+		), err
 	}
 
-	// apply kustomization
-	cmd = fmt.Sprintf("cd %s && kubectl apply -f %s.yaml", tmpDir, kustomization.GetName())
-	if kustomization.Spec.Prune != "" {
-		cmd = fmt.Sprintf("cd %s && kubectl apply -f %s.yaml --prune -l %s",
-			tmpDir, kustomization.GetName(), kustomization.Spec.Prune)
+	manifest, err := resMap.AsYaml()
+	if err != nil {
+		err = fmt.Errorf("kustomize build error: %w", err)
+		return kustomizev1.KustomizationNotReady(
+			kustomization,
+			kustomizev1.BuildFailedReason,
+			err.Error(),
+		), err
 	}
-	command = exec.CommandContext(ctx, "/bin/sh", "-c", cmd)
-	output, err = command.CombinedOutput()
+
+	// expand postBuild.substitute/substituteFrom variables
+	manifest, err = r.substituteVariables(ctx, kustomization, manifest)
 	if err != nil {
-		err = fmt.Errorf("kubectl apply error: %w", err)
+		err = fmt.Errorf("var substitution failed: %w", err)
 		return kustomizev1.KustomizationNotReady(
 			kustomization,
-			kustomizev1.ApplyFailedReason,
+			kustomizev1.VarsSubstitutionFailedReason,
+			err.Error(),
+		), err
+	}
+
+	objects, err := readUnstructuredObjects(manifest)
+	if err != nil {
+		err = fmt.Errorf("kustomize build error: %w", err)
+		return kustomizev1.KustomizationNotReady(
+			kustomization,
+			kustomizev1.BuildFailedReason,
 			err.Error(),
-		), fmt.Errorf("kubectl apply: %s", string(output))
+		), err
 	}
 
-	// log apply output
-	fmt.Println(string(output))
+	// preflight validation, so a typo or bad generator surfaces as a clear
+	// condition instead of a cryptic apply error
+	if err := r.validateObjects(objects); err != nil {
+		err = fmt.Errorf("validation failed: %w", err)
+		return kustomizev1.KustomizationNotReady(
+			kustomization,
+			kustomizev1.ValidationFailedReason,
+			err.Error(),
+		), err
+	}
+
+	// apply resources via server-side apply
+	failures, err := r.apply(ctx, objects, kustomization.Spec.Prune, kustomization.Spec.Force, kustomization.Spec.PartialApply)
+	if err != nil {
+		if kustomization.Spec.PartialApply && len(failures) > 0 {
+			return kustomizev1.KustomizationNotReady(
+				kustomization,
+				kustomizev1.PartiallyAppliedReason,
+				fmt.Sprintf("%s:\n%s", err.Error(), strings.Join(failures, "\n")),
+			), err
+		}
+		err = fmt.Errorf("apply error: %w", err)
+		return kustomizev1.KustomizationNotReady(
+			kustomization,
+			kustomizev1.ApplyFailedReason,
+			err.Error(),
+		), err
+	}
 
 	return kustomizev1.KustomizationReady(
 		kustomization,
@@ -164,3 +287,86 @@ func (r *KustomizationReconciler) sync(
 		"kustomization was successfully applied",
 	), nil
 }
+
+// recordReconciling sets the Ready condition of kustomization to False with
+// ReconcilingReason and
+// persists it using a context detached from the cancelled reconcile context,
+// so a sync cancelled by manager shutdown still leaves behind a status
+// explaining why, instead of being silently killed mid-apply.
+func (r *KustomizationReconciler) recordReconciling(kustomization kustomizev1.Kustomization) error {
+	statusCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	reconciling := kustomizev1.KustomizationNotReady(
+		kustomization,
+		kustomizev1.ReconcilingReason,
+		"reconciliation was cancelled before it could finish",
+	)
+	return r.Status().Update(statusCtx, &reconciling)
+}
+
+// fetchArtifact downloads the tarball at url and extracts its contents into
+// fs, stripping the leading path component the same way `tar --strip-components=1` does.
+func fetchArtifact(ctx context.Context, url string, fs filesys.FileSystem) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status code %d", resp.StatusCode)
+	}
+
+	gzr, err := gzip.NewReader(resp.Body)
+	if err != nil {
+		return fmt.Errorf("invalid gzip stream: %w", err)
+	}
+	defer gzr.Close()
+
+	tr := tar.NewReader(gzr)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		// strip the first path component, mirroring --strip-components=1
+		name := stripFirstComponent(header.Name)
+		if name == "" {
+			continue
+		}
+
+		switch header.Typeflag {
+		case tar.TypeDir:
+			if err := fs.MkdirAll(name); err != nil {
+				return err
+			}
+		case tar.TypeReg:
+			data, err := io.ReadAll(tr)
+			if err != nil {
+				return err
+			}
+			if err := fs.WriteFile(name, data); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+func stripFirstComponent(path string) string {
+	for i := 0; i < len(path); i++ {
+		if path[i] == '/' {
+			return path[i+1:]
+		}
+	}
+	return ""
+}
@@ -0,0 +1,76 @@
+/*
+Copyright 2020 The Flux CD contributors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"fmt"
+	"path/filepath"
+
+	"sigs.k8s.io/kustomize/api/filesys"
+	"sigs.k8s.io/kustomize/api/konfig"
+	"sigs.k8s.io/yaml"
+)
+
+// injectNameOverrides patches the kustomization.yaml found in dir with the
+// given namePrefix/nameSuffix, so callers can reuse the same base across
+// environments without forking it. It is a no-op when both are empty.
+func injectNameOverrides(fs filesys.FileSystem, dir, namePrefix, nameSuffix string) error {
+	if namePrefix == "" && nameSuffix == "" {
+		return nil
+	}
+
+	path, err := locateKustomizationFile(fs, dir)
+	if err != nil {
+		return err
+	}
+
+	data, err := fs.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("unable to read %s: %w", path, err)
+	}
+
+	kustomization := map[string]interface{}{}
+	if err := yaml.Unmarshal(data, &kustomization); err != nil {
+		return fmt.Errorf("unable to parse %s: %w", path, err)
+	}
+
+	if namePrefix != "" {
+		kustomization["namePrefix"] = namePrefix
+	}
+	if nameSuffix != "" {
+		kustomization["nameSuffix"] = nameSuffix
+	}
+
+	out, err := yaml.Marshal(kustomization)
+	if err != nil {
+		return fmt.Errorf("unable to marshal %s: %w", path, err)
+	}
+
+	return fs.WriteFile(path, out)
+}
+
+// locateKustomizationFile returns the path of the kustomization file in dir,
+// trying every name recognized by kustomize.
+func locateKustomizationFile(fs filesys.FileSystem, dir string) (string, error) {
+	for _, name := range konfig.RecognizedKustomizationFileNames() {
+		path := filepath.Join(dir, name)
+		if fs.Exists(path) {
+			return path, nil
+		}
+	}
+	return "", fmt.Errorf("no kustomization file found in %s", dir)
+}
@@ -0,0 +1,108 @@
+/*
+Copyright 2020 The Flux CD contributors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+
+	kustomizev1 "github.com/fluxcd/kustomize-controller/api/v1alpha1"
+)
+
+var (
+	// reconcileConditionGauge reflects the status of a Kustomization's Ready
+	// condition, one series per possible status value so a dashboard can
+	// graph transitions without having to diff gauge values over time.
+	reconcileConditionGauge = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "gotk_reconcile_condition",
+		Help: "The current condition status of a GitOps Toolkit resource reconciliation.",
+	}, []string{"kind", "name", "namespace", "type", "status"})
+
+	// suspendGauge reflects spec.suspend, so users can alert on resources
+	// that have been paused for longer than expected.
+	suspendGauge = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "gotk_suspend_status",
+		Help: "Whether a GitOps Toolkit resource is suspended.",
+	}, []string{"kind", "name", "namespace"})
+
+	// reconcileDurationHistogram tracks how long a single reconciliation of
+	// a Kustomization took, bucketed per resource.
+	reconcileDurationHistogram = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "gotk_reconcile_duration_seconds",
+		Help:    "The duration in seconds of a GitOps Toolkit resource reconciliation.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"kind", "name", "namespace"})
+)
+
+func init() {
+	metrics.Registry.MustRegister(reconcileConditionGauge, suspendGauge, reconcileDurationHistogram)
+}
+
+// recordReadyCondition sets the gotk_reconcile_condition gauge to 1 for
+// kustomization's current Ready status and to 0 for the other possible
+// values, so the series can be graphed directly without post-processing.
+func recordReadyCondition(kustomization kustomizev1.Kustomization) {
+	status := "Unknown"
+	for _, c := range kustomization.Status.Conditions {
+		if c.Type == kustomizev1.ReadyCondition {
+			status = string(c.Status)
+			break
+		}
+	}
+
+	for _, s := range []string{"True", "False", "Unknown"} {
+		value := 0.0
+		if s == status {
+			value = 1
+		}
+		reconcileConditionGauge.WithLabelValues(
+			kustomizev1.KustomizationKind, kustomization.GetName(), kustomization.GetNamespace(),
+			kustomizev1.ReadyCondition, s,
+		).Set(value)
+	}
+}
+
+// recordSuspend sets the gotk_suspend_status gauge for the named
+// Kustomization, or removes its series entirely when deleted is true.
+func recordSuspend(name, namespace string, deleted, suspend bool) {
+	labels := prometheus.Labels{
+		"kind":      kustomizev1.KustomizationKind,
+		"name":      name,
+		"namespace": namespace,
+	}
+
+	if deleted {
+		suspendGauge.Delete(labels)
+		return
+	}
+
+	value := 0.0
+	if suspend {
+		value = 1
+	}
+	suspendGauge.With(labels).Set(value)
+}
+
+// recordReconcileDuration observes the time elapsed since start on the
+// gotk_reconcile_duration_seconds histogram for the named Kustomization.
+func recordReconcileDuration(name, namespace string, start time.Time) {
+	reconcileDurationHistogram.WithLabelValues(
+		kustomizev1.KustomizationKind, name, namespace,
+	).Observe(time.Since(start).Seconds())
+}
@@ -0,0 +1,131 @@
+/*
+Copyright 2020 The Flux CD contributors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+
+	kustomizev1 "github.com/fluxcd/kustomize-controller/api/v1alpha1"
+)
+
+// substVarPattern matches `${var}`, `${var:=default}` and `${var/from/to}`.
+var substVarPattern = regexp.MustCompile(`\$\{([a-zA-Z_][a-zA-Z0-9_-]*)((?::=|/)[^}]*)?\}`)
+
+// substituteVariables expands the postBuild.substitute and
+// postBuild.substituteFrom variables over the rendered manifest. It returns
+// an error naming every variable that could not be resolved, so the
+// Kustomization can be marked VarsSubstitutionFailedReason instead of
+// letting the apply fail on the unexpanded placeholder.
+func (r *KustomizationReconciler) substituteVariables(ctx context.Context, kustomization kustomizev1.Kustomization, in []byte) ([]byte, error) {
+	postBuild := kustomization.Spec.PostBuild
+	if postBuild == nil {
+		return in, nil
+	}
+
+	vars, err := r.loadSubstitutionVars(ctx, kustomization.GetNamespace(), *postBuild)
+	if err != nil {
+		return nil, err
+	}
+
+	var missing []string
+	out := substVarPattern.ReplaceAllStringFunc(string(in), func(match string) string {
+		groups := substVarPattern.FindStringSubmatch(match)
+		name, op := groups[1], groups[2]
+		value, ok := vars[name]
+
+		switch {
+		case strings.HasPrefix(op, ":="):
+			if !ok || value == "" {
+				return op[2:]
+			}
+			return value
+		case strings.HasPrefix(op, "/"):
+			if !ok {
+				missing = append(missing, name)
+				return match
+			}
+			parts := strings.SplitN(op[1:], "/", 2)
+			if len(parts) != 2 {
+				return value
+			}
+			return strings.ReplaceAll(value, parts[0], parts[1])
+		default:
+			if !ok {
+				missing = append(missing, name)
+				return match
+			}
+			return value
+		}
+	})
+
+	if len(missing) > 0 {
+		return nil, fmt.Errorf("required var(s) not found: %s", strings.Join(missing, ", "))
+	}
+
+	return []byte(out), nil
+}
+
+// loadSubstitutionVars merges the data keys of every postBuild.substituteFrom
+// reference into a single variable map, then applies postBuild.substitute on
+// top so inline values win on conflicting keys.
+func (r *KustomizationReconciler) loadSubstitutionVars(ctx context.Context, namespace string, postBuild kustomizev1.PostBuild) (map[string]string, error) {
+	vars := make(map[string]string)
+	for _, ref := range postBuild.SubstituteFrom {
+		data, err := r.loadVarsFrom(ctx, namespace, ref)
+		if err != nil {
+			return nil, err
+		}
+		for k, v := range data {
+			vars[k] = v
+		}
+	}
+	for k, v := range postBuild.Substitute {
+		vars[k] = v
+	}
+	return vars, nil
+}
+
+func (r *KustomizationReconciler) loadVarsFrom(ctx context.Context, namespace string, ref kustomizev1.SubstituteReference) (map[string]string, error) {
+	namespacedName := types.NamespacedName{Namespace: namespace, Name: ref.Name}
+
+	switch ref.Kind {
+	case "ConfigMap":
+		var configMap corev1.ConfigMap
+		if err := r.Client.Get(ctx, namespacedName, &configMap); err != nil {
+			return nil, fmt.Errorf("postBuild.substituteFrom ConfigMap/%s: %w", ref.Name, err)
+		}
+		return configMap.Data, nil
+	case "Secret":
+		var secret corev1.Secret
+		if err := r.Client.Get(ctx, namespacedName, &secret); err != nil {
+			return nil, fmt.Errorf("postBuild.substituteFrom Secret/%s: %w", ref.Name, err)
+		}
+		data := make(map[string]string, len(secret.Data))
+		for k, v := range secret.Data {
+			data[k] = string(v)
+		}
+		return data, nil
+	default:
+		return nil, fmt.Errorf("postBuild.substituteFrom: unsupported kind %q", ref.Kind)
+	}
+}
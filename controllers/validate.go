@@ -0,0 +1,98 @@
+/*
+Copyright 2020 The Flux CD contributors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"fmt"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// validateObjects checks that every object conforms to the basic Kubernetes
+// API conventions before it reaches the apply step, so a typo in a
+// generator or overlay surfaces as a clear ValidationFailedReason instead of
+// a cryptic apply error.
+func (r *KustomizationReconciler) validateObjects(objects []*unstructured.Unstructured) error {
+	var invalid []string
+
+	for _, u := range objects {
+		if err := r.validateObject(u); err != nil {
+			invalid = append(invalid, fmt.Sprintf("%s: %s", describeObject(u), err))
+		}
+	}
+
+	if len(invalid) > 0 {
+		return fmt.Errorf("invalid resource(s):\n%s", strings.Join(invalid, "\n"))
+	}
+	return nil
+}
+
+// validateObject verifies that u has non-empty apiVersion, kind and
+// metadata.name, and, for namespaced kinds resolved against the RESTMapper,
+// a non-empty metadata.namespace.
+func (r *KustomizationReconciler) validateObject(u *unstructured.Unstructured) error {
+	if u.GetAPIVersion() == "" {
+		return fmt.Errorf("apiVersion is empty")
+	}
+	if u.GetKind() == "" {
+		return fmt.Errorf("kind is empty")
+	}
+	if u.GetName() == "" {
+		return fmt.Errorf("metadata.name is empty")
+	}
+
+	namespaced, err := r.isNamespaced(u)
+	if err != nil {
+		return fmt.Errorf("unable to determine scope: %w", err)
+	}
+	if namespaced && u.GetNamespace() == "" {
+		return fmt.Errorf("metadata.namespace is empty")
+	}
+
+	return nil
+}
+
+// isNamespaced resolves u's GroupVersionKind against the RESTMapper to
+// determine whether it is a namespaced or cluster-scoped kind. When no
+// RESTMapper is configured, namespace requirements are not enforced.
+func (r *KustomizationReconciler) isNamespaced(u *unstructured.Unstructured) (bool, error) {
+	if r.RESTMapper == nil {
+		return false, nil
+	}
+
+	gvk := u.GroupVersionKind()
+	mapping, err := r.RESTMapper.RESTMapping(gvk.GroupKind(), gvk.Version)
+	if err != nil {
+		return false, err
+	}
+
+	return mapping.Scope.Name() == meta.RESTScopeNameNamespace, nil
+}
+
+func describeObject(u *unstructured.Unstructured) string {
+	name := u.GetName()
+	if name == "" {
+		name = "<unnamed>"
+	}
+	kind := u.GetKind()
+	if kind == "" {
+		kind = "<unknown kind>"
+	}
+	return fmt.Sprintf("%s/%s", kind, name)
+}
@@ -0,0 +1,157 @@
+/*
+Copyright 2020 The Flux CD contributors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"sigs.k8s.io/kustomize/api/filesys"
+	"sigs.k8s.io/kustomize/api/krusty"
+	"sigs.k8s.io/yaml"
+)
+
+func testRESTMapper() meta.RESTMapper {
+	mapper := meta.NewDefaultRESTMapper([]schema.GroupVersion{{Group: "", Version: "v1"}, {Group: "apps", Version: "v1"}})
+	mapper.Add(schema.GroupVersionKind{Version: "v1", Kind: "ConfigMap"}, meta.RESTScopeNamespace)
+	mapper.Add(schema.GroupVersionKind{Group: "apps", Version: "v1", Kind: "Deployment"}, meta.RESTScopeNamespace)
+	return mapper
+}
+
+// loadTestdata reads path as a generic YAML document into an Unstructured,
+// bypassing unstructured.Unstructured's own UnmarshalJSON (which rejects a
+// missing apiVersion/kind outright) so fixtures can exercise validateObject's
+// own checks for those fields.
+func loadTestdata(t *testing.T, path string) *unstructured.Unstructured {
+	t.Helper()
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatalf("unable to read testdata %q: %v", path, err)
+	}
+
+	var m map[string]interface{}
+	if err := yaml.Unmarshal(data, &m); err != nil {
+		t.Fatalf("unable to parse testdata %q: %v", path, err)
+	}
+	return &unstructured.Unstructured{Object: m}
+}
+
+func TestValidateObject(t *testing.T) {
+	r := &KustomizationReconciler{RESTMapper: testRESTMapper()}
+
+	tests := []struct {
+		name    string
+		path    string
+		wantErr bool
+	}{
+		{"plain layout, missing metadata.name", "testdata/invalid/plain/missing-name.yaml", true},
+		{"plain layout, missing kind", "testdata/invalid/plain/missing-kind.yaml", true},
+		{"plain layout, valid resource", "testdata/invalid/plain/valid.yaml", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			u := loadTestdata(t, tt.path)
+			err := r.validateObject(u)
+			if tt.wantErr && err == nil {
+				t.Fatalf("expected a validation error, got none")
+			}
+			if !tt.wantErr && err != nil {
+				t.Fatalf("expected no validation error, got: %v", err)
+			}
+		})
+	}
+}
+
+// TestReadUnstructuredObjects_MissingKindReachesValidation drives the real
+// readUnstructuredObjects -> validateObjects path a kustomize build result
+// takes, rather than loadTestdata's bypass of unstructured.Unstructured's
+// own UnmarshalJSON. It guards against readUnstructuredObjects rejecting a
+// missing-kind document itself, which would surface as BuildFailedReason
+// and never give validateObjects a chance to report it.
+func TestReadUnstructuredObjects_MissingKindReachesValidation(t *testing.T) {
+	manifest := []byte(`apiVersion: v1
+metadata:
+  name: test-configmap
+  namespace: default
+data:
+  foo: bar
+`)
+
+	objects, err := readUnstructuredObjects(manifest)
+	if err != nil {
+		t.Fatalf("expected the malformed document to parse leniently, got error: %v", err)
+	}
+
+	r := &KustomizationReconciler{RESTMapper: testRESTMapper()}
+	err = r.validateObjects(objects)
+	if err == nil {
+		t.Fatalf("expected a validation error for the missing kind")
+	}
+	if !strings.Contains(err.Error(), "kind is empty") {
+		t.Fatalf("expected validation error to report the empty kind, got: %v", err)
+	}
+}
+
+// TestValidateObjects_OverlayBuild renders an actual base+overlay
+// kustomization through krusty before validating the result, so overlay
+// coverage exercises the real build path rather than a standalone manifest
+// that merely looks like overlay output.
+func TestValidateObjects_OverlayBuild(t *testing.T) {
+	r := &KustomizationReconciler{RESTMapper: testRESTMapper()}
+
+	tests := []struct {
+		name    string
+		dir     string
+		wantErr bool
+	}{
+		{"overlay sets namespace", "testdata/overlay/with-namespace", false},
+		{"overlay omits namespace", "testdata/overlay/without-namespace", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resMap, err := krusty.MakeKustomizer(filesys.MakeFsOnDisk(), krusty.MakeDefaultOptions()).Run(tt.dir)
+			if err != nil {
+				t.Fatalf("kustomize build failed: %v", err)
+			}
+
+			manifest, err := resMap.AsYaml()
+			if err != nil {
+				t.Fatalf("unable to render manifest: %v", err)
+			}
+
+			objects, err := readUnstructuredObjects(manifest)
+			if err != nil {
+				t.Fatalf("unable to parse rendered manifest: %v", err)
+			}
+
+			err = r.validateObjects(objects)
+			if tt.wantErr && err == nil {
+				t.Fatalf("expected a validation error, got none")
+			}
+			if !tt.wantErr && err != nil {
+				t.Fatalf("expected no validation error, got: %v", err)
+			}
+		})
+	}
+}